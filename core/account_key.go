@@ -0,0 +1,30 @@
+// Copyright 2014 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"crypto"
+	"encoding/base64"
+
+	jose "gopkg.in/square/go-jose.v1"
+)
+
+// AccountKey is the JSON Web Key of the account that requested a
+// challenge. The VA uses it to compute the key authorization the client
+// is expected to have provisioned for that challenge.
+type AccountKey jose.JsonWebKey
+
+// Thumbprint returns the base64url-encoded SHA-256 JWK thumbprint of the
+// account key, per RFC 7638. It forms the second half of every ACME key
+// authorization.
+func (k *AccountKey) Thumbprint() (string, error) {
+	jwk := jose.JsonWebKey(*k)
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
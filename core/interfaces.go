@@ -0,0 +1,13 @@
+// Copyright 2014 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+// RegistrationAuthority is the interface the VA uses to report the
+// outcome of a validation back to the component that owns the
+// authorization's lifecycle.
+type RegistrationAuthority interface {
+	OnValidationUpdate(authz Authorization)
+}
@@ -0,0 +1,87 @@
+// Copyright 2014 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+// IdentifierType is the kind of subject an authorization or challenge
+// identifies, per the ACME identifier object.
+type IdentifierType string
+
+// IdentifierDNS is the only IdentifierType boulder currently issues for.
+const IdentifierDNS = IdentifierType("dns")
+
+// AcmeIdentifier is the subject of an authorization, e.g. a DNS name.
+type AcmeIdentifier struct {
+	Type  IdentifierType `json:"type"`
+	Value string         `json:"value"`
+}
+
+// AcmeStatus is the lifecycle state of an authorization or challenge.
+type AcmeStatus string
+
+const (
+	StatusPending = AcmeStatus("pending")
+	StatusValid   = AcmeStatus("valid")
+	StatusInvalid = AcmeStatus("invalid")
+)
+
+// AcmeChallenge identifies a challenge type, e.g. "http-01".
+type AcmeChallenge string
+
+const (
+	ChallengeTypeHTTP01    = AcmeChallenge("http-01")
+	ChallengeTypeDVSNI     = AcmeChallenge("dvsni")
+	ChallengeTypeDNS01     = AcmeChallenge("dns-01")
+	ChallengeTypeTLSALPN01 = AcmeChallenge("tls-alpn-01")
+)
+
+// Challenge is a single challenge offered to prove control of an
+// identifier as part of an Authorization.
+type Challenge struct {
+	Type   AcmeChallenge `json:"type"`
+	Status AcmeStatus    `json:"status"`
+	Token  string        `json:"token"`
+
+	// Nonce, R, and S are used only by the legacy dvsni challenge type.
+	Nonce string `json:"nonce,omitempty"`
+	R     string `json:"r,omitempty"`
+	S     string `json:"s,omitempty"`
+
+	// AccountKey is the JWK of the account this challenge was issued to.
+	// It's populated by the RA before the challenge reaches the VA and is
+	// never serialized to the client, who already has it.
+	AccountKey *AccountKey `json:"-"`
+
+	// Error describes why validation failed. It is nil unless Status is
+	// StatusInvalid.
+	Error *ProblemDetails `json:"error,omitempty"`
+}
+
+// IsSane reports whether the challenge is well-formed enough to attempt
+// validation. If completed is true, fields that are only required once
+// the client has responded are checked as well.
+func (ch Challenge) IsSane(completed bool) bool {
+	if ch.Type == "" {
+		return false
+	}
+	if !completed {
+		return true
+	}
+	// The legacy dvsni challenge authenticates via Nonce/R/S rather than
+	// Token, which is only meaningful for the newer challenge types.
+	if ch.Type == ChallengeTypeDVSNI {
+		return ch.Nonce != "" && ch.R != "" && ch.S != ""
+	}
+	return ch.Token != ""
+}
+
+// Authorization represents a subscriber's authorization to have a
+// certificate issued for an identifier, pending completion of one of
+// its Challenges.
+type Authorization struct {
+	ID         string
+	Identifier AcmeIdentifier
+	Challenges []Challenge
+}
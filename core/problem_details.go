@@ -0,0 +1,26 @@
+// Copyright 2014 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import "fmt"
+
+// ProblemDetails is an RFC 7807 problem document, used to report why a
+// challenge failed validation.
+type ProblemDetails struct {
+	Type       string `json:"type"`
+	Detail     string `json:"detail"`
+	HTTPStatus int    `json:"status,omitempty"`
+
+	// IP is the address the VA actually connected to while validating the
+	// challenge, so operators can tell a misconfigured server from a
+	// network-level attack after the fact. It isn't part of the ACME
+	// problem document sent to the client.
+	IP string `json:"-"`
+}
+
+func (pd *ProblemDetails) Error() string {
+	return fmt.Sprintf("%s :: %s", pd.Type, pd.Detail)
+}
@@ -0,0 +1,14 @@
+// Copyright 2014 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import "encoding/base64"
+
+// B64dec decodes a base64url string without padding, the encoding ACME
+// uses for the R and S values of the legacy dvsni challenge.
+func B64dec(str string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(str)
+}
@@ -6,106 +6,355 @@
 package va
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"crypto/subtle"
 	"crypto/tls"
+	"encoding/asn1"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 )
 
+// dnsChallengeTimeout bounds how long we will wait on a single DNS-01
+// TXT lookup, including any CNAME chasing, before giving up. It's a hard
+// ceiling independent of the caller's deadline, so a Perspective with a
+// generous custom Timeout still can't let a single DNS lookup run away.
+const dnsChallengeTimeout = 10 * time.Second
+
+// defaultPerspectiveTimeout bounds a single perspective's check when it
+// didn't set its own Timeout, and also bounds the historical
+// single-perspective path when the caller's context carries no deadline
+// of its own. It matches dnsChallengeTimeout so that path doesn't clamp
+// DNS-01 below the budget it needs for CNAME chasing before
+// dnsChallengeTimeout gets a chance to apply.
+const defaultPerspectiveTimeout = 10 * time.Second
+
+// ACME problem types the VA reports on core.Challenge.Error, per the
+// error namespace used by RFC 7807/ACME problem documents.
+const (
+	problemTypeConnection    = "urn:ietf:params:acme:error:connection"
+	problemTypeDNS           = "urn:ietf:params:acme:error:dns"
+	problemTypeMalformed     = "urn:ietf:params:acme:error:malformed"
+	problemTypeUnauthorized  = "urn:ietf:params:acme:error:unauthorized"
+	problemTypeTLS           = "urn:ietf:params:acme:error:tls"
+	problemTypeIncorrectResp = "urn:ietf:params:acme:error:incorrectResponse"
+)
+
+// problem builds a core.ProblemDetails describing a validation failure,
+// including the IP the VA actually connected to so operators can tell a
+// misconfigured server from a network-level attack after the fact.
+func problem(problemType, detail string, httpStatus int, resolvedIP string) *core.ProblemDetails {
+	return &core.ProblemDetails{
+		Type:       problemType,
+		Detail:     detail,
+		HTTPStatus: httpStatus,
+		IP:         resolvedIP,
+	}
+}
+
+// Validator solves and checks a single challenge type, in the style of
+// the ChallengeProvider interface implemented by lego's solvers. It lets
+// operators register challenge types the VA doesn't ship with (e.g. a
+// proof-of-possession or out-of-band manual validator) without touching
+// the VA's core dispatch logic, and lets each challenge type be unit
+// tested in isolation.
+type Validator interface {
+	Validate(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge, accountKey *core.AccountKey) core.Challenge
+}
+
+// RemoteVAClient dispatches a validation to a remote VA over gRPC, for a
+// Perspective whose RemoteVA field is set. It is implemented outside this
+// package by the rpc client used to reach the remote boulder-va process.
+type RemoteVAClient interface {
+	PerformValidation(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge, accountKey *core.AccountKey) (core.Challenge, error)
+}
+
+// Perspective describes one network vantage point that validations can be
+// performed from. A single VA can be configured with several Perspectives
+// so that domain validation isn't trivially defeated by an attacker who
+// can only intercept traffic to or from one network location.
+//
+// Exactly one of SourceIP, ProxyURL, or RemoteVA should be set: SourceIP
+// and ProxyURL steer an in-process check out through a different local
+// address or HTTP proxy, while RemoteVA delegates the whole check to
+// another boulder-va instance over gRPC via Client.
+type Perspective struct {
+	// Name identifies the perspective in logs and audit records.
+	Name string
+	// SourceIP, if set, is the local address HTTP/TLS connections are
+	// bound to for this perspective.
+	SourceIP net.IP
+	// ProxyURL, if set, is used as the HTTP proxy for HTTP-01 checks run
+	// from this perspective.
+	ProxyURL string
+	// DNSResolver, if set, overrides the VA's default resolver for DNS-01
+	// checks run from this perspective.
+	DNSResolver string
+	// RemoteVA, if set, is the gRPC address of a remote VA that performs
+	// the check on our behalf; Client must also be set.
+	RemoteVA string
+	Client   RemoteVAClient
+	// Timeout bounds how long this perspective is given to reach a
+	// result before its vote is counted as invalid.
+	Timeout time.Duration
+}
+
+func (p Perspective) localTCPAddr() *net.TCPAddr {
+	if p.SourceIP == nil {
+		return nil
+	}
+	return &net.TCPAddr{IP: p.SourceIP}
+}
+
+func (p Perspective) httpProxy() func(*http.Request) (*url.URL, error) {
+	if p.ProxyURL == "" {
+		return nil
+	}
+	proxyURL, err := url.Parse(p.ProxyURL)
+	if err != nil {
+		return func(*http.Request) (*url.URL, error) { return nil, err }
+	}
+	return http.ProxyURL(proxyURL)
+}
+
+func (p Perspective) timeout() time.Duration {
+	if p.Timeout <= 0 {
+		return defaultPerspectiveTimeout
+	}
+	return p.Timeout
+}
+
 type ValidationAuthorityImpl struct {
 	RA       core.RegistrationAuthority
 	log      *blog.AuditLogger
 	TestMode bool
+
+	// DNSResolver is the host:port of the recursive resolver used for
+	// DNS-01 lookups. If empty, the system resolver is used.
+	DNSResolver string
+
+	// Perspectives lists the network vantage points validations are run
+	// from. A nil or empty slice preserves the historical behavior of
+	// validating once, from this process.
+	Perspectives []Perspective
+	// QuorumThreshold is how many perspectives must agree a challenge is
+	// valid before the VA reports StatusValid. It is ignored when
+	// Perspectives is empty. Operators typically set this to len(Perspectives)
+	// or len(Perspectives)-1 to tolerate a single flaky vantage point.
+	QuorumThreshold int
+
+	validators map[core.AcmeChallenge]Validator
+
+	// cancelMu guards cancelFuncs and cancelGen, which let
+	// CancelValidations abort a validation that UpdateValidations kicked
+	// off for a given authorization.
+	cancelMu    *sync.Mutex
+	cancelFuncs map[string]validationRun
+	// cancelGen is a monotonic counter stamped onto each validationRun so
+	// a run's own cleanup can tell whether the map entry under its
+	// authorization ID still belongs to it, rather than to a later run
+	// for the same authorization that overwrote it.
+	cancelGen uint64
 }
 
-func NewValidationAuthorityImpl(tm bool) ValidationAuthorityImpl {
+// validationRun is one in-flight UpdateValidations call.
+type validationRun struct {
+	cancel     context.CancelFunc
+	generation uint64
+}
+
+// NewValidationAuthorityImpl returns a *ValidationAuthorityImpl rather
+// than a value so that operators can set exported fields like RA and
+// DNSResolver after construction (as boulder-va's main does) and have
+// those changes visible to the validators registered below. Handing back
+// a value here would let the registered validators keep validating
+// against a stale, zero-value copy of the VA forever.
+func NewValidationAuthorityImpl(tm bool) *ValidationAuthorityImpl {
 	logger := blog.GetAuditLogger()
 	logger.Notice("Validation Authority Starting")
-	return ValidationAuthorityImpl{log: logger, TestMode: tm}
+	va := &ValidationAuthorityImpl{
+		log:         logger,
+		TestMode:    tm,
+		validators:  make(map[core.AcmeChallenge]Validator),
+		cancelMu:    new(sync.Mutex),
+		cancelFuncs: make(map[string]validationRun),
+	}
+	va.RegisterValidator(core.ChallengeTypeHTTP01, http01Validator{va: va})
+	va.RegisterValidator(core.ChallengeTypeDVSNI, dvsniValidator{va: va})
+	va.RegisterValidator(core.ChallengeTypeDNS01, dns01Validator{va: va})
+	va.RegisterValidator(core.ChallengeTypeTLSALPN01, tlsALPN01Validator{va: va})
+	return va
+}
+
+// RegisterValidator associates a Validator with a challenge type,
+// overriding any validator previously registered for that type. This is
+// the extension point operators use to add custom challenge types.
+func (va ValidationAuthorityImpl) RegisterValidator(challengeType core.AcmeChallenge, v Validator) {
+	va.validators[challengeType] = v
+}
+
+// dnsResolver returns a net.Resolver that talks to va.DNSResolver, or the
+// system resolver if none was configured.
+func (va ValidationAuthorityImpl) dnsResolver() *net.Resolver {
+	return perspectiveDNSResolver(va.DNSResolver)
+}
+
+// perspectiveDNSResolver returns a net.Resolver that talks to addr, or
+// the system resolver if addr is empty.
+func perspectiveDNSResolver(addr string) *net.Resolver {
+	if addr == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{Timeout: dnsChallengeTimeout}
+			return d.DialContext(ctx, network, addr)
+		},
+	}
 }
 
 // Validation methods
 
-func (va ValidationAuthorityImpl) validateSimpleHTTPS(identifier core.AcmeIdentifier, input core.Challenge) (core.Challenge) {
+// maxHTTP01Redirects bounds how many redirects we will follow while
+// resolving an HTTP-01 challenge, matching the ACME spec's guidance to
+// treat HTTP-01 clients like a normal, cautious HTTP user agent.
+const maxHTTP01Redirects = 10
+
+// maxHTTP01ResponseSize caps how much of the challenge response body we
+// will read, so a malicious or misconfigured server can't run us out of
+// memory.
+const maxHTTP01ResponseSize = 1024 // 1 KiB
+
+// http01RedirectPolicy only allows following redirects to http or https
+// URLs on the default ports, refusing anything else (e.g. file://,
+// non-standard ports, or userinfo-bearing URLs) that could be used to
+// pivot the validation request somewhere unintended.
+func http01RedirectPolicy(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxHTTP01Redirects {
+		return fmt.Errorf("too many redirects")
+	}
+	switch req.URL.Scheme {
+	case "http":
+		if p := req.URL.Port(); p != "" && p != "80" {
+			return fmt.Errorf("redirect to disallowed port %s", p)
+		}
+	case "https":
+		if p := req.URL.Port(); p != "" && p != "443" {
+			return fmt.Errorf("redirect to disallowed port %s", p)
+		}
+	default:
+		return fmt.Errorf("redirect to disallowed scheme %q", req.URL.Scheme)
+	}
+	if req.URL.User != nil {
+		return fmt.Errorf("redirect to URL with userinfo")
+	}
+	return nil
+}
+
+func (va ValidationAuthorityImpl) validateHTTP01(ctx context.Context, identifier core.AcmeIdentifier, input core.Challenge, perspective Perspective) core.Challenge {
 	challenge := input
 
-	if len(challenge.Path) == 0 {
+	if identifier.Type != core.IdentifierDNS {
 		challenge.Status = core.StatusInvalid
-		va.log.Debug("No path provided for SimpleHTTPS challenge.")
+		challenge.Error = problem(problemTypeMalformed, "Identifier type for HTTP-01 was not DNS", 0, "")
+		va.log.Debug("Identifier type for HTTP-01 was not DNS")
 		return challenge
 	}
 
-	if identifier.Type != core.IdentifierDNS {
+	expectedKeyAuthorization, err := keyAuthorization(challenge.Token, challenge.AccountKey)
+	if err != nil {
+		va.log.Debug(fmt.Sprintf("Failed to compute key authorization for HTTP-01: %s", err))
 		challenge.Status = core.StatusInvalid
-		va.log.Debug("Identifier type for SimpleHTTPS was not DNS")
+		challenge.Error = problem(problemTypeMalformed, err.Error(), 0, "")
 		return challenge
 	}
+
 	hostName := identifier.Value
-	protocol := "https"
 	if va.TestMode {
 		hostName = "localhost:5001"
-		protocol = "http"
 	}
 
-	url := fmt.Sprintf("%s://%s/.well-known/acme-challenge/%s", protocol, hostName, challenge.Path)
+	url := fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", hostName, challenge.Token)
 
-	va.log.Notice(fmt.Sprintf("Attempting to validate SimpleHTTPS for %s %s", hostName, url))
+	va.log.Notice(fmt.Sprintf("Attempting to validate HTTP-01 for %s %s", hostName, url))
 	httpRequest, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		va.log.Notice(fmt.Sprintf("Error validating SimpleHTTPS for %s %s: %s", hostName, url, err))
+		va.log.Notice(fmt.Sprintf("Error validating HTTP-01 for %s %s: %s", hostName, url, err))
 		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeMalformed, err.Error(), 0, "")
 		return challenge
 	}
+	httpRequest = httpRequest.WithContext(ctx)
 
-	httpRequest.Host = hostName
+	var resolvedIP string
 	tr := &http.Transport{
-		// We are talking to a client that does not yet have a certificate,
-		// so we accept a temporary, invalid one. TODO: We may want to change this
-		// to just be over HTTP.
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		// We don't expect to make multiple requests to a client, so close
 		// connection immediately.
 		DisableKeepAlives: true,
+		Proxy:             perspective.httpProxy(),
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			d := net.Dialer{LocalAddr: perspective.localTCPAddr()}
+			conn, err := d.DialContext(ctx, network, addr)
+			if err == nil {
+				resolvedIP = conn.RemoteAddr().String()
+			}
+			return conn, err
+		},
 	}
 	client := http.Client{
-		Transport: tr,
-		Timeout:   5 * time.Second,
+		Transport:     tr,
+		CheckRedirect: http01RedirectPolicy,
 	}
 	httpResponse, err := client.Do(httpRequest)
+	if err != nil {
+		va.log.Notice(fmt.Sprintf("Error validating HTTP-01 for %s %s: %s", hostName, url, err))
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeConnection, err.Error(), 0, resolvedIP)
+		return challenge
+	}
+	defer httpResponse.Body.Close()
 
-	if err == nil && httpResponse.StatusCode == 200 {
-		// Read body & test
-		body, err := ioutil.ReadAll(httpResponse.Body)
-		if err != nil {
-			va.log.Notice(fmt.Sprintf("Error validating SimpleHTTPS for %s %s: %s", hostName, url, err))
-			challenge.Status = core.StatusInvalid
-			return challenge
-		}
+	if httpResponse.StatusCode != 200 {
+		va.log.Notice(fmt.Sprintf("Error validating HTTP-01 for %s %s: %d", hostName, url, httpResponse.StatusCode))
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeConnection, fmt.Sprintf("unexpected HTTP status %d", httpResponse.StatusCode), httpResponse.StatusCode, resolvedIP)
+		return challenge
+	}
 
-		if subtle.ConstantTimeCompare(body, []byte(challenge.Token)) == 1 {
-			challenge.Status = core.StatusValid
-		} else {
-			va.log.Notice(fmt.Sprintf("Incorrect token validating SimpleHTTPS for %s %s", hostName, url))
-			challenge.Status = core.StatusInvalid
-		}
-	} else if err != nil {
-		va.log.Notice(fmt.Sprintf("Error validating SimpleHTTPS for %s %s: %s", hostName, url, err))
+	body, err := ioutil.ReadAll(io.LimitReader(httpResponse.Body, maxHTTP01ResponseSize))
+	if err != nil {
+		va.log.Notice(fmt.Sprintf("Error validating HTTP-01 for %s %s: %s", hostName, url, err))
 		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeConnection, err.Error(), 0, resolvedIP)
+		return challenge
+	}
+
+	if subtle.ConstantTimeCompare(bytes.TrimSpace(body), []byte(expectedKeyAuthorization)) == 1 {
+		challenge.Status = core.StatusValid
+		va.log.Notice(fmt.Sprintf("Validated HTTP-01 for %s %s, resolved to %s", hostName, url, resolvedIP))
 	} else {
-		va.log.Notice(fmt.Sprintf("Error validating SimpleHTTPS for %s %s: %d", hostName, url, httpResponse.StatusCode))
+		va.log.Notice(fmt.Sprintf("Incorrect key authorization validating HTTP-01 for %s %s", hostName, url))
 		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeIncorrectResp, "response body did not match the expected key authorization", httpResponse.StatusCode, resolvedIP)
 	}
 
 	return challenge
 }
 
-func (va ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier, input core.Challenge) (core.Challenge) {
+func (va ValidationAuthorityImpl) validateDvsni(ctx context.Context, identifier core.AcmeIdentifier, input core.Challenge, perspective Perspective) core.Challenge {
 	challenge := input
 
 	if identifier.Type != "dns" {
@@ -142,16 +391,21 @@ func (va ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier,
 	}
 	va.log.Notice(fmt.Sprintf("Attempting to validate DVSNI for %s %s %s",
 		identifier, hostPort, zName))
-	conn, err := tls.Dial("tcp", hostPort, &tls.Config{
-		ServerName:         nonceName,
-		InsecureSkipVerify: true,
-	})
-
+	tlsDialer := tls.Dialer{
+		NetDialer: &net.Dialer{LocalAddr: perspective.localTCPAddr()},
+		Config: &tls.Config{
+			ServerName:         nonceName,
+			InsecureSkipVerify: true,
+		},
+	}
+	rawConn, err := tlsDialer.DialContext(ctx, "tcp", hostPort)
 	if err != nil {
 		va.log.Debug("Failed to connect to host for DVSNI challenge")
 		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeConnection, err.Error(), 0, "")
 		return challenge
 	}
+	conn := rawConn.(*tls.Conn)
 	defer conn.Close()
 
 	// Check that zName is a dNSName SAN in the server's certificate
@@ -173,26 +427,411 @@ func (va ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier,
 	return challenge
 }
 
+// acmeTLS1Protocol is the ALPN protocol identifier for tls-alpn-01, as
+// negotiated during the TLS handshake in place of a normal application
+// protocol like h2 or http/1.1.
+const acmeTLS1Protocol = "acme-tls/1"
+
+// idPeAcmeIdentifier is the OID of the acmeIdentifier X.509 extension
+// (id-pe-acmeIdentifier, 1.3.6.1.5.5.7.1.31) that carries the SHA-256
+// digest of the key authorization in a tls-alpn-01 challenge certificate.
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+func (va ValidationAuthorityImpl) validateTLSALPN01(ctx context.Context, identifier core.AcmeIdentifier, input core.Challenge, perspective Perspective) core.Challenge {
+	challenge := input
+
+	if identifier.Type != core.IdentifierDNS {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeMalformed, "Identifier type for TLS-ALPN-01 was not DNS", 0, "")
+		va.log.Debug("Identifier type for TLS-ALPN-01 was not DNS")
+		return challenge
+	}
+
+	expectedDigest, err := keyAuthorizationDigest(challenge.Token, challenge.AccountKey)
+	if err != nil {
+		va.log.Debug(fmt.Sprintf("Failed to compute key authorization for TLS-ALPN-01: %s", err))
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeMalformed, err.Error(), 0, "")
+		return challenge
+	}
+	expectedDigestBytes, err := base64.RawURLEncoding.DecodeString(expectedDigest)
+	if err != nil {
+		va.log.Debug(fmt.Sprintf("Failed to decode key authorization digest for TLS-ALPN-01: %s", err))
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeMalformed, err.Error(), 0, "")
+		return challenge
+	}
+
+	hostPort := identifier.Value + ":443"
+	if va.TestMode {
+		hostPort = "localhost:5001"
+	}
+
+	va.log.Notice(fmt.Sprintf("Attempting to validate TLS-ALPN-01 for %s %s", identifier, hostPort))
+	tlsDialer := tls.Dialer{
+		NetDialer: &net.Dialer{LocalAddr: perspective.localTCPAddr()},
+		Config: &tls.Config{
+			ServerName:         identifier.Value,
+			NextProtos:         []string{acmeTLS1Protocol},
+			InsecureSkipVerify: true,
+		},
+	}
+	rawConn, err := tlsDialer.DialContext(ctx, "tcp", hostPort)
+	if err != nil {
+		va.log.Debug(fmt.Sprintf("Failed to connect to host for TLS-ALPN-01 challenge: %s", err))
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeConnection, err.Error(), 0, "")
+		return challenge
+	}
+	conn := rawConn.(*tls.Conn)
+	defer conn.Close()
+
+	cs := conn.ConnectionState()
+	if cs.NegotiatedProtocol != acmeTLS1Protocol {
+		va.log.Debug(fmt.Sprintf("Server did not negotiate %s for TLS-ALPN-01", acmeTLS1Protocol))
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeTLS, fmt.Sprintf("server did not negotiate %s", acmeTLS1Protocol), 0, "")
+		return challenge
+	}
+
+	certs := cs.PeerCertificates
+	if len(certs) == 0 {
+		va.log.Debug("No certs presented for TLS-ALPN-01 challenge")
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeTLS, "no certificate presented", 0, "")
+		return challenge
+	}
+	cert := certs[0]
+
+	// CheckSignatureFrom also enforces CA constraints (BasicConstraintsValid
+	// && IsCA, KeyUsageCertSign), which a self-signed leaf cert from a
+	// tls-alpn-01 client won't satisfy. CheckSignature only verifies that
+	// the cert's own key produced its own signature, so it's paired with
+	// an explicit issuer/subject comparison below to confirm the cert
+	// actually claims to be self-signed, not just self-signable.
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		va.log.Debug("TLS-ALPN-01 challenge certificate was not self-signed")
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeTLS, "challenge certificate was not self-signed", 0, "")
+		return challenge
+	}
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		va.log.Debug("TLS-ALPN-01 challenge certificate issuer did not match its subject")
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeTLS, "challenge certificate was not self-signed", 0, "")
+		return challenge
+	}
+
+	sanMatch := false
+	for _, name := range cert.DNSNames {
+		if subtle.ConstantTimeCompare([]byte(name), []byte(identifier.Value)) == 1 {
+			sanMatch = true
+			break
+		}
+	}
+	if !sanMatch {
+		va.log.Debug("TLS-ALPN-01 challenge certificate did not contain the identifier as a dNSName SAN")
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeTLS, "certificate did not contain the identifier as a dNSName SAN", 0, "")
+		return challenge
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(idPeAcmeIdentifier) {
+			continue
+		}
+		if !ext.Critical {
+			va.log.Debug("id-pe-acmeIdentifier extension was not marked critical")
+			challenge.Status = core.StatusInvalid
+			challenge.Error = problem(problemTypeTLS, "id-pe-acmeIdentifier extension was not marked critical", 0, "")
+			return challenge
+		}
+		var digest []byte
+		if _, err := asn1.Unmarshal(ext.Value, &digest); err != nil {
+			va.log.Debug(fmt.Sprintf("Failed to parse id-pe-acmeIdentifier extension: %s", err))
+			challenge.Status = core.StatusInvalid
+			challenge.Error = problem(problemTypeTLS, err.Error(), 0, "")
+			return challenge
+		}
+		if subtle.ConstantTimeCompare(digest, expectedDigestBytes) == 1 {
+			challenge.Status = core.StatusValid
+		} else {
+			va.log.Debug("id-pe-acmeIdentifier extension did not match expected key authorization digest")
+			challenge.Status = core.StatusInvalid
+			challenge.Error = problem(problemTypeIncorrectResp, "id-pe-acmeIdentifier extension did not match expected key authorization digest", 0, "")
+		}
+		return challenge
+	}
+
+	va.log.Debug("No id-pe-acmeIdentifier extension found in TLS-ALPN-01 challenge certificate")
+	challenge.Status = core.StatusInvalid
+	challenge.Error = problem(problemTypeTLS, "no id-pe-acmeIdentifier extension found", 0, "")
+	return challenge
+}
+
+// keyAuthorization computes the ACME key authorization for a challenge:
+// token || "." || JWK thumbprint of the account key.
+func keyAuthorization(token string, accountKey *core.AccountKey) (string, error) {
+	thumbprint, err := accountKey.Thumbprint()
+	if err != nil {
+		return "", err
+	}
+	return token + "." + thumbprint, nil
+}
+
+// keyAuthorizationDigest computes the SHA-256 digest of the ACME key
+// authorization for a challenge, base64url-encoded without padding.
+func keyAuthorizationDigest(token string, accountKey *core.AccountKey) (string, error) {
+	ka, err := keyAuthorization(token, accountKey)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(ka))
+	return base64.RawURLEncoding.EncodeToString(digest[:]), nil
+}
+
+func (va ValidationAuthorityImpl) validateDNS01(ctx context.Context, identifier core.AcmeIdentifier, input core.Challenge, perspective Perspective) core.Challenge {
+	challenge := input
+
+	if identifier.Type != core.IdentifierDNS {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeMalformed, "Identifier type for DNS-01 was not DNS", 0, "")
+		va.log.Debug("Identifier type for DNS-01 was not DNS")
+		return challenge
+	}
+
+	expectedDigest, err := keyAuthorizationDigest(challenge.Token, challenge.AccountKey)
+	if err != nil {
+		va.log.Debug(fmt.Sprintf("Failed to compute key authorization for DNS-01: %s", err))
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeMalformed, err.Error(), 0, "")
+		return challenge
+	}
+
+	dnsName := "_acme-challenge." + identifier.Value
+
+	// dnsChallengeTimeout still bounds this lookup even when ctx carries
+	// no deadline of its own (e.g. when a dns01Validator is called directly
+	// rather than through validateFromPerspectives).
+	lookupCtx, cancel := context.WithTimeout(ctx, dnsChallengeTimeout)
+	defer cancel()
+
+	resolver := va.dnsResolver()
+	if perspective.DNSResolver != "" {
+		resolver = perspectiveDNSResolver(perspective.DNSResolver)
+	}
+
+	// net.Resolver.LookupTXT follows CNAMEs on our behalf, per the
+	// standard resolution algorithm.
+	txtRecords, err := resolver.LookupTXT(lookupCtx, dnsName)
+	if err != nil {
+		va.log.Notice(fmt.Sprintf("Error validating DNS-01 for %s: %s", dnsName, err))
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeDNS, err.Error(), 0, "")
+		return challenge
+	}
+
+	for _, txt := range txtRecords {
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(txt)), []byte(expectedDigest)) == 1 {
+			challenge.Status = core.StatusValid
+			return challenge
+		}
+	}
+
+	va.log.Notice(fmt.Sprintf("No matching TXT record found for DNS-01 at %s", dnsName))
+	challenge.Status = core.StatusInvalid
+	challenge.Error = problem(problemTypeIncorrectResp, "no TXT record with the expected key authorization digest", 0, "")
+	return challenge
+}
+
+// Validator adapters
+//
+// These wrap the concrete validateXxx methods above so each challenge
+// type can be registered, replaced, and tested independently via the
+// Validator interface.
+
+type http01Validator struct {
+	va          *ValidationAuthorityImpl
+	perspective Perspective
+}
+
+func (v http01Validator) Validate(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge, accountKey *core.AccountKey) core.Challenge {
+	challenge.AccountKey = accountKey
+	return v.va.validateHTTP01(ctx, identifier, challenge, v.perspective)
+}
+
+func (v http01Validator) withPerspective(p Perspective) Validator {
+	v.perspective = p
+	return v
+}
+
+type dvsniValidator struct {
+	va          *ValidationAuthorityImpl
+	perspective Perspective
+}
+
+func (v dvsniValidator) Validate(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge, accountKey *core.AccountKey) core.Challenge {
+	return v.va.validateDvsni(ctx, identifier, challenge, v.perspective)
+}
+
+func (v dvsniValidator) withPerspective(p Perspective) Validator {
+	v.perspective = p
+	return v
+}
+
+type dns01Validator struct {
+	va          *ValidationAuthorityImpl
+	perspective Perspective
+}
+
+func (v dns01Validator) Validate(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge, accountKey *core.AccountKey) core.Challenge {
+	challenge.AccountKey = accountKey
+	return v.va.validateDNS01(ctx, identifier, challenge, v.perspective)
+}
+
+func (v dns01Validator) withPerspective(p Perspective) Validator {
+	v.perspective = p
+	return v
+}
+
+type tlsALPN01Validator struct {
+	va          *ValidationAuthorityImpl
+	perspective Perspective
+}
+
+func (v tlsALPN01Validator) Validate(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge, accountKey *core.AccountKey) core.Challenge {
+	challenge.AccountKey = accountKey
+	return v.va.validateTLSALPN01(ctx, identifier, challenge, v.perspective)
+}
+
+func (v tlsALPN01Validator) withPerspective(p Perspective) Validator {
+	v.perspective = p
+	return v
+}
+
+// perspectiveAware is implemented by validators whose check runs directly
+// out through the network (the VA's four built-in validators) so that
+// validateFromPerspectives can steer them to a specific Perspective's
+// source IP, proxy, or DNS resolver. A Validator registered via
+// RegisterValidator that doesn't implement it - e.g. one that only
+// consults ctx, or delegates to another system - runs unmodified for
+// every perspective.
+type perspectiveAware interface {
+	withPerspective(p Perspective) Validator
+}
+
+// perspectiveResult is one perspective's vote on a challenge, kept for
+// the audit log alongside the aggregate decision.
+type perspectiveResult struct {
+	perspective string
+	challenge   core.Challenge
+	err         error
+}
+
+// validateFromPerspectives runs challengeType validation for identifier
+// from every configured Perspective concurrently, and returns a challenge
+// whose Status is StatusValid only if at least QuorumThreshold
+// perspectives agree. Each perspective's outcome is written to the audit
+// log so a disagreement can be investigated after the fact.
+//
+// If no perspectives are configured, this falls back to a single local
+// check, preserving the historical single-vantage-point behavior.
+func (va ValidationAuthorityImpl) validateFromPerspectives(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge) core.Challenge {
+	if len(va.Perspectives) == 0 {
+		validator, ok := va.validators[challenge.Type]
+		if !ok {
+			challenge.Status = core.StatusInvalid
+			return challenge
+		}
+		// context.WithTimeout takes the earlier of this deadline and any
+		// deadline already on ctx, so this only shortens an unbounded ctx.
+		localCtx, cancel := context.WithTimeout(ctx, defaultPerspectiveTimeout)
+		defer cancel()
+		return validator.Validate(localCtx, identifier, challenge, challenge.AccountKey)
+	}
+
+	results := make(chan perspectiveResult, len(va.Perspectives))
+	for _, p := range va.Perspectives {
+		go func(p Perspective) {
+			perspectiveCtx, cancel := context.WithTimeout(ctx, p.timeout())
+			defer cancel()
+
+			if p.RemoteVA != "" {
+				remoteChallenge, err := p.Client.PerformValidation(perspectiveCtx, identifier, challenge, challenge.AccountKey)
+				results <- perspectiveResult{perspective: p.Name, challenge: remoteChallenge, err: err}
+				return
+			}
+
+			validator, ok := va.validators[challenge.Type]
+			if !ok {
+				results <- perspectiveResult{perspective: p.Name, err: fmt.Errorf("no validator for challenge type %s", challenge.Type)}
+				return
+			}
+			if pa, ok := validator.(perspectiveAware); ok {
+				validator = pa.withPerspective(p)
+			}
+			result := validator.Validate(perspectiveCtx, identifier, challenge, challenge.AccountKey)
+			results <- perspectiveResult{perspective: p.Name, challenge: result}
+		}(p)
+	}
+
+	quorum := va.QuorumThreshold
+	if quorum <= 0 {
+		quorum = len(va.Perspectives)
+	}
+
+	agreed := 0
+	for i := 0; i < len(va.Perspectives); i++ {
+		result := <-results
+		if result.err != nil {
+			va.log.Audit(fmt.Sprintf("Perspective %s failed to validate %s: %s", result.perspective, identifier.Value, result.err))
+			continue
+		}
+		va.log.Audit(fmt.Sprintf("Perspective %s validated %s: %s", result.perspective, identifier.Value, result.challenge.Status))
+		if result.challenge.Status == core.StatusValid {
+			agreed++
+		}
+	}
+
+	if agreed >= quorum {
+		challenge.Status = core.StatusValid
+	} else {
+		detail := fmt.Sprintf("%d/%d perspectives agreed, needed %d", agreed, len(va.Perspectives), quorum)
+		va.log.Notice(fmt.Sprintf("Quorum not reached validating %s: %s", identifier.Value, detail))
+		challenge.Status = core.StatusInvalid
+		challenge.Error = problem(problemTypeUnauthorized, detail, 0, "")
+	}
+	return challenge
+}
+
 // Overall validation process
 
-func (va ValidationAuthorityImpl) validate(authz core.Authorization) {
-	// Select the first supported validation method
-	// XXX: Remove the "break" lines to process all supported validations
+func (va ValidationAuthorityImpl) validate(ctx context.Context, authz core.Authorization) {
 	for i, challenge := range authz.Challenges {
+		if ctx.Err() != nil {
+			va.log.Debug(fmt.Sprintf("Validation of %s canceled: %s", authz.ID, ctx.Err()))
+			challenge.Status = core.StatusInvalid
+			challenge.Error = problem(problemTypeConnection, ctx.Err().Error(), 0, "")
+			authz.Challenges[i] = challenge
+			continue
+		}
+
 		if !challenge.IsSane(true) {
 			va.log.Debug(fmt.Sprintf("Challenge not considered sane: %v", challenge))
 			challenge.Status = core.StatusInvalid
+			challenge.Error = problem(problemTypeMalformed, "challenge failed sanity check", 0, "")
+			authz.Challenges[i] = challenge
 			continue
 		}
 
-		switch challenge.Type {
-		case core.ChallengeTypeSimpleHTTPS:
-			authz.Challenges[i] = va.validateSimpleHTTPS(authz.Identifier, challenge)
-			break
-		case core.ChallengeTypeDVSNI:
-			authz.Challenges[i] = va.validateDvsni(authz.Identifier, challenge)
-			break
+		if _, ok := va.validators[challenge.Type]; !ok {
+			va.log.Debug(fmt.Sprintf("No validator registered for challenge type %s", challenge.Type))
+			challenge.Status = core.StatusInvalid
+			challenge.Error = problem(problemTypeMalformed, fmt.Sprintf("unsupported challenge type %s", challenge.Type), 0, "")
+			authz.Challenges[i] = challenge
+			continue
 		}
+		authz.Challenges[i] = va.validateFromPerspectives(ctx, authz.Identifier, challenge)
 	}
 
 	va.log.Notice(fmt.Sprintf("Validations: %v", authz))
@@ -200,7 +839,47 @@ func (va ValidationAuthorityImpl) validate(authz core.Authorization) {
 	va.RA.OnValidationUpdate(authz)
 }
 
-func (va ValidationAuthorityImpl) UpdateValidations(authz core.Authorization) error {
-	go va.validate(authz)
+// UpdateValidations kicks off validation of authz's challenges in the
+// background. The validation honors ctx's deadline and can be aborted
+// early with CancelValidations(authz.ID) if the RA decides the
+// authorization is no longer needed (e.g. the registration was revoked).
+func (va *ValidationAuthorityImpl) UpdateValidations(ctx context.Context, authz core.Authorization) error {
+	validationCtx, cancel := context.WithCancel(ctx)
+
+	va.cancelMu.Lock()
+	va.cancelGen++
+	generation := va.cancelGen
+	va.cancelFuncs[authz.ID] = validationRun{cancel: cancel, generation: generation}
+	va.cancelMu.Unlock()
+
+	go func() {
+		defer func() {
+			va.cancelMu.Lock()
+			// Only remove the entry if it's still ours - a later
+			// UpdateValidations call for the same authorization may have
+			// already replaced it, and we must not delete that one.
+			if run, ok := va.cancelFuncs[authz.ID]; ok && run.generation == generation {
+				delete(va.cancelFuncs, authz.ID)
+			}
+			va.cancelMu.Unlock()
+			cancel()
+		}()
+		va.validate(validationCtx, authz)
+	}()
+	return nil
+}
+
+// CancelValidations aborts the in-flight validation started for authzID
+// by UpdateValidations. It returns an error if no validation is
+// currently running for that authorization.
+func (va *ValidationAuthorityImpl) CancelValidations(authzID string) error {
+	va.cancelMu.Lock()
+	run, ok := va.cancelFuncs[authzID]
+	va.cancelMu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no validation in progress for authorization %s", authzID)
+	}
+	run.cancel()
 	return nil
 }
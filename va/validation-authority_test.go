@@ -0,0 +1,260 @@
+// Copyright 2014 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	jose "gopkg.in/square/go-jose.v1"
+)
+
+const testToken = "evaGxfADs6pSRb2LAv9IZf17Dt3juxGJ-PCt92wr-oA"
+
+// testAccountKey returns an AccountKey good enough to compute a key
+// authorization from, along with its JWK thumbprint.
+func testAccountKey(t *testing.T) (*core.AccountKey, string) {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating account key: %s", err)
+	}
+	jwk := core.AccountKey(jose.JsonWebKey{Key: &priv.PublicKey})
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatalf("computing thumbprint: %s", err)
+	}
+	return &jwk, thumbprint
+}
+
+// testVA returns a ValidationAuthorityImpl configured the way boulder's
+// own test suite runs it: in TestMode, so the HTTP-01, DVSNI and TLS-ALPN-01
+// validators dial localhost:5001 regardless of the identifier they're given.
+func testVA(t *testing.T) *ValidationAuthorityImpl {
+	t.Helper()
+	return NewValidationAuthorityImpl(true)
+}
+
+func TestValidateHTTP01(t *testing.T) {
+	accountKey, thumbprint := testAccountKey(t)
+	keyAuthorization := testToken + "." + thumbprint
+
+	listener, err := net.Listen("tcp", "127.0.0.1:5001")
+	if err != nil {
+		t.Fatalf("listening on :5001: %s", err)
+	}
+	defer listener.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/acme-challenge/"+testToken, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, keyAuthorization)
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	va := testVA(t)
+	identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"}
+	challenge := core.Challenge{Type: core.ChallengeTypeHTTP01, Token: testToken, AccountKey: accountKey}
+
+	result := va.validateHTTP01(context.Background(), identifier, challenge, Perspective{})
+	if result.Status != core.StatusValid {
+		t.Fatalf("expected StatusValid, got %s (error: %v)", result.Status, result.Error)
+	}
+}
+
+func TestValidateHTTP01WrongBody(t *testing.T) {
+	accountKey, _ := testAccountKey(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:5001")
+	if err != nil {
+		t.Fatalf("listening on :5001: %s", err)
+	}
+	defer listener.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/acme-challenge/"+testToken, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "not the key authorization")
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	va := testVA(t)
+	identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"}
+	challenge := core.Challenge{Type: core.ChallengeTypeHTTP01, Token: testToken, AccountKey: accountKey}
+
+	result := va.validateHTTP01(context.Background(), identifier, challenge, Perspective{})
+	if result.Status != core.StatusInvalid {
+		t.Fatalf("expected StatusInvalid for mismatched body, got %s", result.Status)
+	}
+}
+
+// tlsALPN01Cert builds a self-signed certificate of the kind an ACME
+// client presents for a tls-alpn-01 challenge: it's a dNSName SAN for
+// name, and carries the id-pe-acmeIdentifier extension with digest.
+func tlsALPN01Cert(t *testing.T, name string, digest []byte) tls.Certificate {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating leaf key: %s", err)
+	}
+
+	extValue, err := asn1.Marshal(digest)
+	if err != nil {
+		t.Fatalf("marshaling acmeIdentifier extension: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: idPeAcmeIdentifier, Critical: true, Value: extValue},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("creating certificate: %s", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}
+}
+
+func serveTLSALPN01(t *testing.T, cert tls.Certificate) net.Listener {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:5001", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{acmeTLS1Protocol},
+	})
+	if err != nil {
+		t.Fatalf("listening on :5001: %s", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				c.(*tls.Conn).Handshake()
+			}(conn)
+		}
+	}()
+	return listener
+}
+
+func TestValidateTLSALPN01(t *testing.T) {
+	accountKey, _ := testAccountKey(t)
+	challenge := core.Challenge{Type: core.ChallengeTypeTLSALPN01, Token: testToken, AccountKey: accountKey}
+	digest, err := keyAuthorizationDigest(challenge.Token, challenge.AccountKey)
+	if err != nil {
+		t.Fatalf("computing key authorization digest: %s", err)
+	}
+	digestBytes, err := core.B64dec(digest)
+	if err != nil {
+		t.Fatalf("decoding digest: %s", err)
+	}
+
+	cert := tlsALPN01Cert(t, "example.com", digestBytes)
+	listener := serveTLSALPN01(t, cert)
+	defer listener.Close()
+
+	va := testVA(t)
+	identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"}
+
+	result := va.validateTLSALPN01(context.Background(), identifier, challenge, Perspective{})
+	if result.Status != core.StatusValid {
+		t.Fatalf("expected StatusValid, got %s (error: %v)", result.Status, result.Error)
+	}
+}
+
+func TestValidateTLSALPN01WrongDigest(t *testing.T) {
+	accountKey, _ := testAccountKey(t)
+	challenge := core.Challenge{Type: core.ChallengeTypeTLSALPN01, Token: testToken, AccountKey: accountKey}
+
+	cert := tlsALPN01Cert(t, "example.com", sha256Sum([]byte("not the expected digest")))
+	listener := serveTLSALPN01(t, cert)
+	defer listener.Close()
+
+	va := testVA(t)
+	identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"}
+
+	result := va.validateTLSALPN01(context.Background(), identifier, challenge, Perspective{})
+	if result.Status != core.StatusInvalid {
+		t.Fatalf("expected StatusInvalid for mismatched digest, got %s", result.Status)
+	}
+}
+
+// fakeRemoteVA is a RemoteVAClient whose vote is fixed at construction,
+// standing in for a remote perspective in the quorum tests below.
+type fakeRemoteVA struct {
+	status core.AcmeStatus
+	err    error
+}
+
+func (f fakeRemoteVA) PerformValidation(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge, accountKey *core.AccountKey) (core.Challenge, error) {
+	if f.err != nil {
+		return core.Challenge{}, f.err
+	}
+	challenge.Status = f.status
+	return challenge, nil
+}
+
+func TestValidateFromPerspectivesQuorum(t *testing.T) {
+	cases := []struct {
+		name       string
+		votes      []core.AcmeStatus
+		threshold  int
+		wantStatus core.AcmeStatus
+	}{
+		{"unanimous valid", []core.AcmeStatus{core.StatusValid, core.StatusValid, core.StatusValid}, 3, core.StatusValid},
+		{"one dissenter tolerated", []core.AcmeStatus{core.StatusValid, core.StatusValid, core.StatusInvalid}, 2, core.StatusValid},
+		{"quorum not reached", []core.AcmeStatus{core.StatusValid, core.StatusInvalid, core.StatusInvalid}, 2, core.StatusInvalid},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			va := testVA(t)
+			for i, status := range c.votes {
+				va.Perspectives = append(va.Perspectives, Perspective{
+					Name:     fmt.Sprintf("perspective-%d", i),
+					RemoteVA: "fake",
+					Client:   fakeRemoteVA{status: status},
+				})
+			}
+			va.QuorumThreshold = c.threshold
+
+			challenge := core.Challenge{Type: core.ChallengeTypeHTTP01, Token: testToken, Status: core.StatusPending}
+			identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"}
+
+			result := va.validateFromPerspectives(context.Background(), identifier, challenge)
+			if result.Status != c.wantStatus {
+				t.Fatalf("expected %s, got %s", c.wantStatus, result.Status)
+			}
+		})
+	}
+}
+
+func sha256Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}